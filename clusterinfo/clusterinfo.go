@@ -0,0 +1,218 @@
+// Package clusterinfo periodically polls an Elasticsearch cluster's root
+// endpoint for its name, UUID, and version, and makes the latest known
+// values available to every collector so they can label their metrics
+// consistently without each re-implementing the same poll.
+package clusterinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ClusterInfo is the subset of GET / that collectors label their metrics
+// with.
+type ClusterInfo struct {
+	ClusterName string
+	ClusterUUID string
+	ESVersion   string
+}
+
+type rootResponse struct {
+	ClusterName string `json:"cluster_name"`
+	ClusterUUID string `json:"cluster_uuid"`
+	Version     struct {
+		Number string `json:"number"`
+	} `json:"version"`
+}
+
+// Retriever polls GET / on an interval and caches the result behind an
+// RWMutex. It also implements prometheus.Collector so it can be registered
+// directly to expose the static elasticsearch_cluster_info gauge and a
+// last-successful-retrieval timestamp.
+type Retriever struct {
+	url      string
+	client   *http.Client
+	interval time.Duration
+	esUser   string
+	esPass   string
+
+	mu          sync.RWMutex
+	current     ClusterInfo
+	lastSuccess time.Time
+
+	subsMu sync.Mutex
+	subs   []chan<- ClusterInfo
+
+	clusterInfoMetric *prometheus.Desc
+	lastSuccessMetric *prometheus.Desc
+}
+
+// New builds a Retriever for url, polling every interval once started.
+// esUser/esPass, if set, are sent as basic auth on every poll.
+func New(url string, client *http.Client, interval time.Duration, esUser, esPass string) *Retriever {
+	return &Retriever{
+		url:      url,
+		client:   client,
+		interval: interval,
+		esUser:   esUser,
+		esPass:   esPass,
+
+		clusterInfoMetric: prometheus.NewDesc(
+			"elasticsearch_cluster_info",
+			"Static metric labeled with the cluster's name, UUID, and Elasticsearch version",
+			[]string{"cluster", "cluster_uuid", "es_version"},
+			nil,
+		),
+		lastSuccessMetric: prometheus.NewDesc(
+			"clusterinfo_last_retrieval_success_ts",
+			"Unix timestamp of the last successful cluster info retrieval",
+			nil,
+			nil,
+		),
+	}
+}
+
+// Get returns the last known ClusterInfo. Before the first successful poll
+// it is the zero value.
+func (r *Retriever) Get() ClusterInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// Subscribe registers ch to receive every successfully polled ClusterInfo.
+// Sends are non-blocking: a subscriber that isn't reading misses updates
+// instead of stalling the poll loop.
+func (r *Retriever) Subscribe(ch chan<- ClusterInfo) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+	r.subs = append(r.subs, ch)
+}
+
+// Run blocks until the first successful poll (making up to 5 attempts, 2s
+// apart) so metrics never go out with empty cluster labels, then starts
+// the background poll loop and returns.
+func (r *Retriever) Run(ctx context.Context) error {
+	const (
+		firstPollRetries = 5
+		firstPollBackoff = 2 * time.Second
+	)
+
+	var lastErr error
+	for attempt := 0; attempt < firstPollRetries; attempt++ {
+		info, err := r.poll(ctx)
+		if err == nil {
+			r.update(info)
+			go r.loop(ctx)
+			return nil
+		}
+		lastErr = err
+
+		select {
+		case <-time.After(firstPollBackoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return fmt.Errorf("clusterinfo: no successful poll after %d attempts: %w", firstPollRetries, lastErr)
+}
+
+func (r *Retriever) loop(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := r.poll(ctx)
+			if err != nil {
+				// Keep the last-known-good value; lastSuccessMetric simply
+				// stops advancing until a poll succeeds again.
+				continue
+			}
+			r.update(info)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *Retriever) update(info ClusterInfo) {
+	r.mu.Lock()
+	r.current = info
+	r.lastSuccess = time.Now()
+	r.mu.Unlock()
+
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+	for _, ch := range r.subs {
+		select {
+		case ch <- info:
+		default:
+		}
+	}
+}
+
+func (r *Retriever) poll(ctx context.Context) (ClusterInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", r.url, nil)
+	if err != nil {
+		return ClusterInfo{}, fmt.Errorf("creating request: %w", err)
+	}
+	if r.esUser != "" && r.esPass != "" {
+		req.SetBasicAuth(r.esUser, r.esPass)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return ClusterInfo{}, fmt.Errorf("fetching cluster info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ClusterInfo{}, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var root rootResponse
+	if err := json.NewDecoder(resp.Body).Decode(&root); err != nil {
+		return ClusterInfo{}, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return ClusterInfo{
+		ClusterName: root.ClusterName,
+		ClusterUUID: root.ClusterUUID,
+		ESVersion:   root.Version.Number,
+	}, nil
+}
+
+func (r *Retriever) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.clusterInfoMetric
+	ch <- r.lastSuccessMetric
+}
+
+func (r *Retriever) Collect(ch chan<- prometheus.Metric) {
+	r.mu.RLock()
+	info := r.current
+	lastSuccess := r.lastSuccess
+	r.mu.RUnlock()
+
+	ch <- prometheus.MustNewConstMetric(
+		r.clusterInfoMetric,
+		prometheus.GaugeValue,
+		1,
+		info.ClusterName, info.ClusterUUID, info.ESVersion,
+	)
+
+	ts := 0.0
+	if !lastSuccess.IsZero() {
+		ts = float64(lastSuccess.Unix())
+	}
+	ch <- prometheus.MustNewConstMetric(r.lastSuccessMetric, prometheus.GaugeValue, ts)
+}
@@ -1,219 +1,415 @@
 package collector
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
+
+	"elasticsearch-shard-exporter/clusterinfo"
 )
 
 const (
-	namespace = "trendyol_nosql"
+	namespace   = "trendyol_nosql"
+	esNamespace = "es"
+
+	defaultIndicesSelector = "_all"
+	defaultESTimeout       = 10 * time.Second
 )
 
+// esHealthColors enumerates the cluster/index health colors emitted by
+// es_index_status, in the order they're written to each scrape.
+var esHealthColors = []string{"green", "yellow", "red"}
+
+// clusterLabelNames are appended to every per-index/per-shard metric so a
+// single Prometheus instance scraping multiple clusters can tell their
+// series apart.
+var clusterLabelNames = []string{"cluster", "cluster_uuid", "es_version"}
+
 type CollectorConfig struct {
 	ESURL         string
 	ESUser        string
 	ESPass        string
 	SSLEnable     bool
 	SSLSkipVerify bool
+
+	// IndicesSelector scopes collection to a comma-separated list of index
+	// patterns (e.g. "logs-*,metrics-*"). Defaults to "_all".
+	IndicesSelector string
+
+	// APIKey, when set, is sent as `Authorization: ApiKey <key>` on every
+	// request, unless AWSRegion is also set, in which case SigV4 signing is
+	// used instead. Typically sourced from the ES_API_KEY environment variable.
+	APIKey string
+
+	// AWSRegion enables SigV4 request signing for Amazon OpenSearch Service.
+	// AWSRoleARN, if set, is assumed via STS before signing.
+	AWSRegion  string
+	AWSRoleARN string
+
+	// CAFile, ClientCertFile, and ClientKeyFile configure mTLS against
+	// Elasticsearch clusters with certificate-based cluster security.
+	CAFile         string
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// Timeout bounds each individual ES API call the ShardCollector makes
+	// during a scrape. Defaults to defaultESTimeout. NodesCollector and
+	// SnapshotCollector do not apply it.
+	Timeout time.Duration
+
+	// Retries is the number of additional attempts the ShardCollector makes
+	// for a failed endpoint call on a 5xx response or network error, with
+	// exponential backoff starting at RetryBackoff. NodesCollector and
+	// SnapshotCollector do not retry.
+	Retries      int
+	RetryBackoff time.Duration
 }
 
+// ClusterHealthResponse is the subset of GET /_cluster/health?level=indices
+// that the collector cares about.
 type ClusterHealthResponse struct {
-	ClusterName                 string  `json:"cluster_name"`
-	Status                      string  `json:"status"`
-	TimedOut                    bool    `json:"timed_out"`
-	NumberOfNodes               int     `json:"number_of_nodes"`
-	NumberOfDataNodes           int     `json:"number_of_data_nodes"`
-	ActivePrimaryShards         int     `json:"active_primary_shards"`
-	ActiveShards                int     `json:"active_shards"`
-	RelocatingShards            int     `json:"relocating_shards"`
-	InitializingShards          int     `json:"initializing_shards"`
-	UnassignedShards            int     `json:"unassigned_shards"`
-	DelayedUnassignedShards     int     `json:"delayed_unassigned_shards"`
-	NumberOfPendingTasks        int     `json:"number_of_pending_tasks"`
-	NumberOfInFlightFetch       int     `json:"number_of_in_flight_fetch"`
-	TaskMaxWaitingInQueueMillis int     `json:"task_max_waiting_in_queue_millis"`
-	ActiveShardsPercentAsNumber float64 `json:"active_shards_percent_as_number"`
+	ClusterName         string                 `json:"cluster_name"`
+	Status              string                 `json:"status"`
+	TimedOut            bool                   `json:"timed_out"`
+	NumberOfNodes       int                    `json:"number_of_nodes"`
+	NumberOfDataNodes   int                    `json:"number_of_data_nodes"`
+	ActivePrimaryShards int                    `json:"active_primary_shards"`
+	ActiveShards        int                    `json:"active_shards"`
+	RelocatingShards    int                    `json:"relocating_shards"`
+	InitializingShards  int                    `json:"initializing_shards"`
+	UnassignedShards    int                    `json:"unassigned_shards"`
+	Indices             map[string]IndexHealth `json:"indices"`
 }
 
-type IndexSettingsResponse map[string]IndexSettings
+// IndexHealth is the per-index block of a level=indices cluster health
+// response.
+type IndexHealth struct {
+	Status              string `json:"status"`
+	NumberOfShards      int    `json:"number_of_shards"`
+	NumberOfReplicas    int    `json:"number_of_replicas"`
+	ActivePrimaryShards int    `json:"active_primary_shards"`
+	ActiveShards        int    `json:"active_shards"`
+	RelocatingShards    int    `json:"relocating_shards"`
+	InitializingShards  int    `json:"initializing_shards"`
+	UnassignedShards    int    `json:"unassigned_shards"`
+}
 
-type IndexSettings struct {
-	Settings struct {
-		Index struct {
-			NumberOfReplicas string `json:"number_of_replicas"`
-			NumberOfShards   string `json:"number_of_shards"`
-		} `json:"index"`
-	} `json:"settings"`
+// catShardEntry is a single row of GET /_cat/shards?format=json&bytes=b.
+type catShardEntry struct {
+	Index  string `json:"index"`
+	Shard  string `json:"shard"`
+	PriRep string `json:"prirep"`
+	State  string `json:"state"`
+	Docs   string `json:"docs"`
+	Store  string `json:"store"`
+	IP     string `json:"ip"`
+	Node   string `json:"node"`
 }
 
 type ShardCollector struct {
-	config CollectorConfig
-	client *http.Client
-	mutex  sync.RWMutex
-
-	shardRelocationMetric *prometheus.Desc
-	shardReplicaMetric    *prometheus.Desc
-	scrapeErrorMetric     *prometheus.Desc
-	scrapeDurationMetric  *prometheus.Desc
+	config      CollectorConfig
+	client      *http.Client
+	clusterInfo *clusterinfo.Retriever
+	mutex       sync.RWMutex
+
+	indexShardsActiveMetric       *prometheus.Desc
+	indexShardsUnassignedMetric   *prometheus.Desc
+	indexShardsInitializingMetric *prometheus.Desc
+	indexShardsRelocatingMetric   *prometheus.Desc
+	indexStatusMetric             *prometheus.Desc
+	shardDocsMetric               *prometheus.Desc
+	shardStoreBytesMetric         *prometheus.Desc
+	shardNodeMetric               *prometheus.Desc
+
+	scrapeDurationMetric *prometheus.Desc
+	scrapeSuccessMetric  *prometheus.Desc
+
+	indicesSelectorInfoMetric *prometheus.Desc
 }
 
-func NewShardCollector(config CollectorConfig) (*ShardCollector, error) {
-	transport := &http.Transport{
-		MaxIdleConns:        10,
-		IdleConnTimeout:     30 * time.Second,
-		DisableCompression:  false,
-		TLSHandshakeTimeout: 10 * time.Second,
+// NewShardCollector builds a ShardCollector. ci may be nil, in which case
+// the cluster/cluster_uuid/es_version labels are emitted empty.
+func NewShardCollector(config CollectorConfig, ci *clusterinfo.Retriever) (*ShardCollector, error) {
+	if config.IndicesSelector == "" {
+		config.IndicesSelector = defaultIndicesSelector
 	}
 
-	if config.SSLEnable {
-		transport.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: config.SSLSkipVerify,
-		}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultESTimeout
 	}
 
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   30 * time.Second,
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
 	}
 
 	return &ShardCollector{
-		config: config,
-		client: client,
-
-		shardRelocationMetric: prometheus.NewDesc(
-			"trendyol_nosql_shard_relocation",
-			"Elasticsearch shard relocation status",
-			[]string{"status"},
+		config:      config,
+		client:      client,
+		clusterInfo: ci,
+
+		indexShardsActiveMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "index", "shards_active"),
+			"Number of active shards for an index",
+			append([]string{"index"}, clusterLabelNames...),
 			nil,
 		),
-
-		shardReplicaMetric: prometheus.NewDesc(
-			"trendyol_nosql_shard_replica",
-			"Elasticsearch shard replica count",
-			[]string{"count"},
+		indexShardsUnassignedMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "index", "shards_unassigned"),
+			"Number of unassigned shards for an index",
+			append([]string{"index"}, clusterLabelNames...),
 			nil,
 		),
-
-		scrapeErrorMetric: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "exporter", "scrape_error"),
-			"Scrape error status",
+		indexShardsInitializingMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "index", "shards_initializing"),
+			"Number of initializing shards for an index",
+			append([]string{"index"}, clusterLabelNames...),
+			nil,
+		),
+		indexShardsRelocatingMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "index", "shards_relocating"),
+			"Number of relocating shards for an index",
+			append([]string{"index"}, clusterLabelNames...),
+			nil,
+		),
+		indexStatusMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "index", "status"),
+			"Health status of an index, one gauge per color set to 1 for the current status",
+			append([]string{"index", "color"}, clusterLabelNames...),
+			nil,
+		),
+		shardDocsMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "shard", "docs"),
+			"Number of documents in a shard",
+			append([]string{"index", "shard", "node"}, clusterLabelNames...),
+			nil,
+		),
+		shardStoreBytesMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "shard", "store_bytes"),
+			"Size of a shard's store in bytes",
+			append([]string{"index", "shard", "node"}, clusterLabelNames...),
 			nil,
+		),
+		shardNodeMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "shard", "node"),
+			"Presence of a shard copy on a node, labeled with its primary/replica role",
+			append([]string{"index", "shard", "primary", "node"}, clusterLabelNames...),
 			nil,
 		),
 
 		scrapeDurationMetric: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "exporter", "scrape_duration_seconds"),
-			"Duration of the scrape in seconds",
+			prometheus.BuildFQName(esNamespace, "scrape", "duration_seconds"),
+			"Duration of a single ES API call made during a scrape",
+			[]string{"endpoint"},
 			nil,
+		),
+		scrapeSuccessMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "scrape", "success"),
+			"Whether a single ES API call made during a scrape succeeded",
+			[]string{"endpoint"},
+			nil,
+		),
+
+		indicesSelectorInfoMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "indices_selector", "info"),
+			"Always 1, labeled with the index pattern the collector is scoped to",
+			[]string{"pattern"},
 			nil,
 		),
 	}, nil
 }
 
 func (c *ShardCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- c.shardRelocationMetric
-	ch <- c.shardReplicaMetric
-	ch <- c.scrapeErrorMetric
+	ch <- c.indexShardsActiveMetric
+	ch <- c.indexShardsUnassignedMetric
+	ch <- c.indexShardsInitializingMetric
+	ch <- c.indexShardsRelocatingMetric
+	ch <- c.indexStatusMetric
+	ch <- c.shardDocsMetric
+	ch <- c.shardStoreBytesMetric
+	ch <- c.shardNodeMetric
 	ch <- c.scrapeDurationMetric
+	ch <- c.scrapeSuccessMetric
+	ch <- c.indicesSelectorInfoMetric
 }
 
+// Collect implements prometheus.Collector using a background context. Use
+// CollectContext directly when a request-scoped deadline is available (see
+// the RequestCollector wrapper).
 func (c *ShardCollector) Collect(ch chan<- prometheus.Metric) {
+	c.CollectContext(context.Background(), ch)
+}
+
+// endpointResult carries one ES API call's outcome back to CollectContext,
+// since the two calls run concurrently via errgroup and must not write to ch
+// from more than one goroutine at a time.
+type endpointResult struct {
+	endpoint string
+	duration time.Duration
+	err      error
+}
+
+// CollectContext fans out the cluster-health and cat-shards calls as
+// goroutines sharing ctx, so a slow endpoint no longer stalls the other one.
+// Each gets its own Timeout budget and retry/backoff; partial results are
+// still emitted when one endpoint fails.
+func (c *ShardCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	start := time.Now()
-	scrapeError := 0.0
+	var cluster, clusterUUID, esVersion string
+	if c.clusterInfo != nil {
+		info := c.clusterInfo.Get()
+		cluster, clusterUUID, esVersion = info.ClusterName, info.ClusterUUID, info.ESVersion
+	}
 
-	health, err := c.fetchClusterHealth()
-	if err != nil {
-		log.Printf("Error fetching cluster health: %v", err)
-		scrapeError = 1.0
-	} else {
-		relocationStatus := "inactive"
-		if health.RelocatingShards > 0 {
-			relocationStatus = "active"
+	var health *ClusterHealthResponse
+	var shards []catShardEntry
+	results := make(chan endpointResult, 2)
+
+	ch <- prometheus.MustNewConstMetric(c.indicesSelectorInfoMetric, prometheus.GaugeValue, 1, c.config.IndicesSelector)
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		start := time.Now()
+		h, err := c.fetchClusterHealth(gctx)
+		health = h
+		results <- endpointResult{endpoint: "cluster_health", duration: time.Since(start), err: err}
+		return nil
+	})
+
+	g.Go(func() error {
+		start := time.Now()
+		s, err := c.fetchCatShards(gctx)
+		shards = s
+		results <- endpointResult{endpoint: "cat_shards", duration: time.Since(start), err: err}
+		return nil
+	})
+
+	// g.Wait() never returns an error here since both goroutines always
+	// return nil, but it's still how we block for both to finish.
+	_ = g.Wait()
+	close(results)
+
+	for res := range results {
+		success := 1.0
+		if res.err != nil {
+			log.Printf("Error fetching %s: %v", res.endpoint, res.err)
+			success = 0.0
 		}
-		ch <- prometheus.MustNewConstMetric(
-			c.shardRelocationMetric,
-			prometheus.GaugeValue,
-			1,
-			relocationStatus,
-		)
+		ch <- prometheus.MustNewConstMetric(c.scrapeDurationMetric, prometheus.GaugeValue, res.duration.Seconds(), res.endpoint)
+		ch <- prometheus.MustNewConstMetric(c.scrapeSuccessMetric, prometheus.GaugeValue, success, res.endpoint)
 	}
 
-	replicas, err := c.fetchMaxReplicaCount()
-	if err != nil {
-		log.Printf("Error fetching replica count: %v", err)
-		scrapeError = 1.0
-	} else {
-		ch <- prometheus.MustNewConstMetric(
-			c.shardReplicaMetric,
-			prometheus.GaugeValue,
-			1,
-			fmt.Sprintf("%d", replicas),
-		)
-	}
-
-	ch <- prometheus.MustNewConstMetric(
-		c.scrapeErrorMetric,
-		prometheus.GaugeValue,
-		scrapeError,
-	)
-
-	ch <- prometheus.MustNewConstMetric(
-		c.scrapeDurationMetric,
-		prometheus.GaugeValue,
-		time.Since(start).Seconds(),
-	)
-}
+	if health != nil {
+		for index, h := range health.Indices {
+			ch <- prometheus.MustNewConstMetric(c.indexShardsActiveMetric, prometheus.GaugeValue, float64(h.ActiveShards), index, cluster, clusterUUID, esVersion)
+			ch <- prometheus.MustNewConstMetric(c.indexShardsUnassignedMetric, prometheus.GaugeValue, float64(h.UnassignedShards), index, cluster, clusterUUID, esVersion)
+			ch <- prometheus.MustNewConstMetric(c.indexShardsInitializingMetric, prometheus.GaugeValue, float64(h.InitializingShards), index, cluster, clusterUUID, esVersion)
+			ch <- prometheus.MustNewConstMetric(c.indexShardsRelocatingMetric, prometheus.GaugeValue, float64(h.RelocatingShards), index, cluster, clusterUUID, esVersion)
+
+			for _, color := range esHealthColors {
+				value := 0.0
+				if h.Status == color {
+					value = 1.0
+				}
+				ch <- prometheus.MustNewConstMetric(c.indexStatusMetric, prometheus.GaugeValue, value, index, color, cluster, clusterUUID, esVersion)
+			}
+		}
+	}
 
-func (c *ShardCollector) fetchClusterHealth() (*ClusterHealthResponse, error) {
-	url := fmt.Sprintf("%s/_cluster/health", c.config.ESURL)
+	for _, s := range shards {
+		primary := "false"
+		if s.PriRep == "p" {
+			primary = "true"
+		}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		// Unassigned copies have no node and are indistinguishable from one
+		// another under these labels; skip them here rather than emit
+		// duplicate const metrics for indices with multiple replicas.
+		if s.State != "UNASSIGNED" {
+			ch <- prometheus.MustNewConstMetric(c.shardNodeMetric, prometheus.GaugeValue, 1, s.Index, s.Shard, primary, s.Node, cluster, clusterUUID, esVersion)
+		}
+
+		if docs, ok := parseIntField(s.Docs); ok {
+			ch <- prometheus.MustNewConstMetric(c.shardDocsMetric, prometheus.GaugeValue, docs, s.Index, s.Shard, s.Node, cluster, clusterUUID, esVersion)
+		}
+		if store, ok := parseIntField(s.Store); ok {
+			ch <- prometheus.MustNewConstMetric(c.shardStoreBytesMetric, prometheus.GaugeValue, store, s.Index, s.Shard, s.Node, cluster, clusterUUID, esVersion)
+		}
 	}
+}
 
-	if c.config.ESUser != "" && c.config.ESPass != "" {
-		req.SetBasicAuth(c.config.ESUser, c.config.ESPass)
+// parseIntField parses a /_cat numeric column, which Elasticsearch renders as
+// an empty string for unassigned shards.
+func parseIntField(s string) (float64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	var v float64
+	if _, err := fmt.Sscanf(s, "%f", &v); err != nil {
+		return 0, false
 	}
+	return v, true
+}
 
-	req.Header.Set("Accept", "application/json")
+// indexPath scopes an ES API path to the configured indices selector. Both
+// /_cluster/health and /_cat/shards take the index target as a path segment
+// *after* the endpoint, e.g. /_cluster/health/logs-* and /_cat/shards/logs-*.
+func (c *ShardCollector) indexPath(base string) string {
+	if c.config.IndicesSelector == "" || c.config.IndicesSelector == defaultIndicesSelector {
+		return base
+	}
+	return base + "/" + strings.TrimPrefix(c.config.IndicesSelector, "/")
+}
 
-	resp, err := c.client.Do(req)
+func (c *ShardCollector) fetchClusterHealth(ctx context.Context) (*ClusterHealthResponse, error) {
+	url := fmt.Sprintf("%s%s?level=indices", c.config.ESURL, c.indexPath("/_cluster/health"))
+
+	var health ClusterHealthResponse
+	err := withRetry(ctx, c.config.Retries, c.config.RetryBackoff, func() error {
+		return c.getJSON(ctx, url, &health)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch cluster health: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
-	}
+	return &health, nil
+}
 
-	var health ClusterHealthResponse
-	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+func (c *ShardCollector) fetchCatShards(ctx context.Context) ([]catShardEntry, error) {
+	url := fmt.Sprintf("%s%s?format=json&bytes=b", c.config.ESURL, c.indexPath("/_cat/shards"))
+
+	var shards []catShardEntry
+	err := withRetry(ctx, c.config.Retries, c.config.RetryBackoff, func() error {
+		return c.getJSON(ctx, url, &shards)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch shard catalog: %w", err)
 	}
 
-	return &health, nil
+	return shards, nil
 }
 
-func (c *ShardCollector) fetchMaxReplicaCount() (int, error) {
-	url := fmt.Sprintf("%s/_settings", c.config.ESURL)
+// getJSON issues a single authenticated GET bounded by the collector's
+// configured per-endpoint Timeout, decoding the JSON response into out.
+func (c *ShardCollector) getJSON(ctx context.Context, url string, out interface{}) error {
+	reqCtx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(reqCtx, "GET", url, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	if c.config.ESUser != "" && c.config.ESPass != "" {
@@ -224,28 +420,18 @@ func (c *ShardCollector) fetchMaxReplicaCount() (int, error) {
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("failed to fetch index settings: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
-	}
-
-	var settings IndexSettingsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&settings); err != nil {
-		return 0, fmt.Errorf("failed to decode response: %w", err)
+		return &httpStatusError{statusCode: resp.StatusCode, body: string(body)}
 	}
 
-	maxReplicas := 0
-	for _, indexSettings := range settings {
-		var replicas int
-		fmt.Sscanf(indexSettings.Settings.Index.NumberOfReplicas, "%d", &replicas)
-		if replicas > maxReplicas {
-			maxReplicas = replicas
-		}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return maxReplicas, nil
+	return nil
 }
@@ -0,0 +1,34 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ContextCollector is a prometheus.Collector whose scrape can be bounded by
+// a caller-supplied context, so an HTTP handler can derive one from the
+// inbound request and have it cancel in-flight ES API calls when the client
+// goes away or --es.timeout budgets expire.
+type ContextCollector interface {
+	prometheus.Collector
+	CollectContext(ctx context.Context, ch chan<- prometheus.Metric)
+}
+
+// RequestCollector adapts a ContextCollector to plain prometheus.Collector
+// by pinning it to a single context, e.g. one built from http.Request.Context
+// for the duration of a single scrape. /probe registers its collector through
+// this wrapper; the collectors on --metrics-path are registered directly and
+// collect with context.Background.
+type RequestCollector struct {
+	Inner ContextCollector
+	Ctx   context.Context
+}
+
+func (r *RequestCollector) Describe(ch chan<- *prometheus.Desc) {
+	r.Inner.Describe(ch)
+}
+
+func (r *RequestCollector) Collect(ch chan<- prometheus.Metric) {
+	r.Inner.CollectContext(r.Ctx, ch)
+}
@@ -0,0 +1,223 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"elasticsearch-shard-exporter/clusterinfo"
+)
+
+// nodeStat is one entry of the "nodes" map returned by /_nodes/stats. Each
+// section is decoded as a raw interface{} blob and flattened recursively,
+// following the same approach as the Telegraf elasticsearch input, since the
+// shape of these blocks varies across ES versions and we only want the
+// numeric leaves.
+type nodeStat struct {
+	Name       string                 `json:"name"`
+	Host       string                 `json:"host"`
+	Indices    map[string]interface{} `json:"indices"`
+	OS         map[string]interface{} `json:"os"`
+	Process    map[string]interface{} `json:"process"`
+	JVM        map[string]interface{} `json:"jvm"`
+	ThreadPool map[string]interface{} `json:"thread_pool"`
+	FS         map[string]interface{} `json:"fs"`
+	Transport  map[string]interface{} `json:"transport"`
+	HTTP       map[string]interface{} `json:"http"`
+	Breakers   map[string]interface{} `json:"breakers"`
+}
+
+type nodesStatsResponse struct {
+	ClusterName string              `json:"cluster_name"`
+	Nodes       map[string]nodeStat `json:"nodes"`
+}
+
+// NodesCollector scrapes /_nodes/stats and emits flattened numeric metrics
+// for every node, labeled {node, host, section, path} plus the shared cluster
+// labels. It is gated behind --collector.nodes since it can be a heavy call
+// on large clusters.
+type NodesCollector struct {
+	config      CollectorConfig
+	client      *http.Client
+	clusterInfo *clusterinfo.Retriever
+	mutex       sync.RWMutex
+
+	// Local restricts the call to the node handling the request
+	// (/_nodes/_local/stats) instead of the whole cluster.
+	Local bool
+
+	nodeStatMetric       *prometheus.Desc
+	scrapeErrorMetric    *prometheus.Desc
+	scrapeDurationMetric *prometheus.Desc
+}
+
+// NewNodesCollector builds a NodesCollector. ci may be nil, in which case the
+// cluster/cluster_uuid/es_version labels are emitted empty.
+func NewNodesCollector(config CollectorConfig, local bool, ci *clusterinfo.Retriever) (*NodesCollector, error) {
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NodesCollector{
+		config:      config,
+		client:      client,
+		clusterInfo: ci,
+		Local:       local,
+
+		nodeStatMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "node", "stat"),
+			"Flattened numeric value from /_nodes/stats, labeled with its section path",
+			append([]string{"node", "host", "section", "path"}, clusterLabelNames...),
+			nil,
+		),
+
+		scrapeErrorMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "nodes_exporter", "scrape_error"),
+			"Scrape error status for the nodes collector",
+			nil,
+			nil,
+		),
+
+		scrapeDurationMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "nodes_exporter", "scrape_duration_seconds"),
+			"Duration of the nodes stats scrape in seconds",
+			nil,
+			nil,
+		),
+	}, nil
+}
+
+func (c *NodesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.nodeStatMetric
+	ch <- c.scrapeErrorMetric
+	ch <- c.scrapeDurationMetric
+}
+
+func (c *NodesCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	start := time.Now()
+	scrapeError := 0.0
+
+	var cluster, clusterUUID, esVersion string
+	if c.clusterInfo != nil {
+		info := c.clusterInfo.Get()
+		cluster, clusterUUID, esVersion = info.ClusterName, info.ClusterUUID, info.ESVersion
+	}
+
+	stats, err := c.fetchNodesStats()
+	if err != nil {
+		log.Printf("Error fetching node stats: %v", err)
+		scrapeError = 1.0
+	} else {
+		for nodeID, node := range stats.Nodes {
+			sections := map[string]map[string]interface{}{
+				"indices":     node.Indices,
+				"os":          node.OS,
+				"process":     node.Process,
+				"jvm":         node.JVM,
+				"thread_pool": node.ThreadPool,
+				"fs":          node.FS,
+				"transport":   node.Transport,
+				"http":        node.HTTP,
+				"breakers":    node.Breakers,
+			}
+
+			for section, blob := range sections {
+				for path, value := range flattenNumeric(blob) {
+					ch <- prometheus.MustNewConstMetric(
+						c.nodeStatMetric,
+						prometheus.GaugeValue,
+						value,
+						nodeOrID(node.Name, nodeID), node.Host, section, path, cluster, clusterUUID, esVersion,
+					)
+				}
+			}
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.scrapeErrorMetric, prometheus.GaugeValue, scrapeError)
+	ch <- prometheus.MustNewConstMetric(c.scrapeDurationMetric, prometheus.GaugeValue, time.Since(start).Seconds())
+}
+
+func nodeOrID(name, id string) string {
+	if name != "" {
+		return name
+	}
+	return id
+}
+
+// flattenNumeric walks a decoded JSON object recursively and returns every
+// numeric leaf, keyed by its dotted path (e.g. "mem.heap_used_in_bytes").
+// Non-numeric leaves (strings, bools, nulls) are skipped since they don't
+// map to Prometheus gauge values.
+func flattenNumeric(blob map[string]interface{}) map[string]float64 {
+	out := make(map[string]float64)
+	flattenInto(out, "", blob)
+	return out
+}
+
+func flattenInto(out map[string]float64, prefix string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			flattenInto(out, path, child)
+		}
+	case float64:
+		out[prefix] = v
+	case bool:
+		// Skip: booleans aren't meaningful gauge values.
+	default:
+		// Skip strings, nulls, arrays, and anything else non-numeric.
+	}
+}
+
+func (c *NodesCollector) fetchNodesStats() (*nodesStatsResponse, error) {
+	path := "/_nodes/stats"
+	if c.Local {
+		path = "/_nodes/_local/stats"
+	}
+
+	url := fmt.Sprintf("%s%s", c.config.ESURL, path)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if c.config.ESUser != "" && c.config.ESPass != "" {
+		req.SetBasicAuth(c.config.ESUser, c.config.ESPass)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch node stats: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	var stats nodesStatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// httpStatusError records a non-2xx HTTP response so callers can decide
+// whether it's worth retrying (5xx) versus failing fast (4xx).
+type httpStatusError struct {
+	statusCode int
+	body       string
+}
+
+func (e *httpStatusError) Error() string {
+	return "unexpected status code " + http.StatusText(e.statusCode) + ": " + e.body
+}
+
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode >= 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// withRetry calls fn up to retries+1 times, waiting backoff*2^attempt
+// between attempts, stopping early on a non-retryable error or context
+// cancellation.
+func withRetry(ctx context.Context, retries int, backoff time.Duration, fn func() error) error {
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || !isRetryable(err) || attempt >= retries {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff * time.Duration(1<<attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"elasticsearch-shard-exporter/clusterinfo"
+)
+
+// snapshotRepositoriesResponse is the shape of GET /_snapshot/_all: a map
+// keyed by repository name, whose values we don't need beyond the keys.
+type snapshotRepositoriesResponse map[string]json.RawMessage
+
+type repositorySnapshotsResponse struct {
+	Snapshots []snapshotInfo `json:"snapshots"`
+}
+
+type snapshotInfo struct {
+	Snapshot          string `json:"snapshot"`
+	State             string `json:"state"`
+	StartTimeInMillis int64  `json:"start_time_in_millis"`
+	DurationInMillis  int64  `json:"duration_in_millis"`
+	Shards            struct {
+		Total  int `json:"total"`
+		Failed int `json:"failed"`
+	} `json:"shards"`
+}
+
+// slmPolicyEntry is one value of the map returned by GET /_slm/policy.
+type slmPolicyEntry struct {
+	LastSuccess struct {
+		Time int64 `json:"time"`
+	} `json:"last_success"`
+	LastFailure struct {
+		Time int64 `json:"time"`
+	} `json:"last_failure"`
+}
+
+// slmStatusResponse is the shape of GET /_slm/status, which carries the SLM
+// operation mode (/_slm/stats does not).
+type slmStatusResponse struct {
+	OperationMode string `json:"operation_mode"`
+}
+
+type slmStatsResponse struct {
+	PolicyStats []slmPolicyStats `json:"policy_stats"`
+}
+
+type slmPolicyStats struct {
+	Policy                  string `json:"policy"`
+	SnapshotsTaken          int64  `json:"snapshots_taken"`
+	SnapshotsFailed         int64  `json:"snapshots_failed"`
+	SnapshotsDeleted        int64  `json:"snapshots_deleted"`
+	SnapshotsFailedToDelete int64  `json:"snapshots_failed_to_delete"`
+}
+
+// SnapshotCollector scrapes repository snapshots and SLM (Snapshot Lifecycle
+// Management) state. Each half is independently gated since operators may
+// run SLM without wanting the (potentially large) snapshot enumeration, or
+// vice versa.
+type SnapshotCollector struct {
+	config      CollectorConfig
+	client      *http.Client
+	clusterInfo *clusterinfo.Retriever
+	mutex       sync.RWMutex
+
+	CollectSnapshots bool
+	CollectSLM       bool
+
+	snapshotStateMetric        *prometheus.Desc
+	snapshotStartTimeMetric    *prometheus.Desc
+	snapshotDurationMetric     *prometheus.Desc
+	snapshotFailedShardsMetric *prometheus.Desc
+	snapshotTotalShardsMetric  *prometheus.Desc
+
+	slmPolicyLastSuccessMetric *prometheus.Desc
+	slmPolicyLastFailureMetric *prometheus.Desc
+	slmOperationModeMetric     *prometheus.Desc
+	slmSnapshotsTakenMetric    *prometheus.Desc
+	slmSnapshotsFailedMetric   *prometheus.Desc
+	slmSnapshotsDeletedMetric  *prometheus.Desc
+
+	scrapeErrorMetric    *prometheus.Desc
+	scrapeDurationMetric *prometheus.Desc
+}
+
+// NewSnapshotCollector builds a SnapshotCollector. ci may be nil, in which
+// case the cluster/cluster_uuid/es_version labels are emitted empty.
+func NewSnapshotCollector(config CollectorConfig, collectSnapshots, collectSLM bool, ci *clusterinfo.Retriever) (*SnapshotCollector, error) {
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SnapshotCollector{
+		config:      config,
+		client:      client,
+		clusterInfo: ci,
+
+		CollectSnapshots: collectSnapshots,
+		CollectSLM:       collectSLM,
+
+		snapshotStateMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "snapshot", "state"),
+			"Snapshot state (1 for the snapshot's current state, labeled by state)",
+			append([]string{"repo", "snapshot", "state"}, clusterLabelNames...),
+			nil,
+		),
+		snapshotStartTimeMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "snapshot", "start_time_seconds"),
+			"Snapshot start time in seconds since epoch",
+			append([]string{"repo", "snapshot"}, clusterLabelNames...),
+			nil,
+		),
+		snapshotDurationMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "snapshot", "duration_seconds"),
+			"Snapshot duration in seconds",
+			append([]string{"repo", "snapshot"}, clusterLabelNames...),
+			nil,
+		),
+		snapshotFailedShardsMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "snapshot", "failed_shards"),
+			"Number of shards that failed in a snapshot",
+			append([]string{"repo", "snapshot"}, clusterLabelNames...),
+			nil,
+		),
+		snapshotTotalShardsMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "snapshot", "total_shards"),
+			"Total number of shards in a snapshot",
+			append([]string{"repo", "snapshot"}, clusterLabelNames...),
+			nil,
+		),
+
+		slmPolicyLastSuccessMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "slm_policy", "last_success_timestamp"),
+			"Unix timestamp of an SLM policy's last successful snapshot",
+			append([]string{"policy"}, clusterLabelNames...),
+			nil,
+		),
+		slmPolicyLastFailureMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "slm_policy", "last_failure_timestamp"),
+			"Unix timestamp of an SLM policy's last failed snapshot",
+			append([]string{"policy"}, clusterLabelNames...),
+			nil,
+		),
+		slmOperationModeMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "slm", "operation_mode"),
+			"SLM operation mode (1 for the current mode, labeled by mode)",
+			append([]string{"mode"}, clusterLabelNames...),
+			nil,
+		),
+		slmSnapshotsTakenMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "slm_policy", "snapshots_taken_total"),
+			"Cumulative count of snapshots successfully taken by an SLM policy",
+			append([]string{"policy"}, clusterLabelNames...),
+			nil,
+		),
+		slmSnapshotsFailedMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "slm_policy", "snapshots_failed_total"),
+			"Cumulative count of snapshot failures for an SLM policy",
+			append([]string{"policy"}, clusterLabelNames...),
+			nil,
+		),
+		slmSnapshotsDeletedMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(esNamespace, "slm_policy", "snapshots_deleted_total"),
+			"Cumulative count of snapshots deleted by an SLM policy",
+			append([]string{"policy"}, clusterLabelNames...),
+			nil,
+		),
+
+		scrapeErrorMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "snapshot_exporter", "scrape_error"),
+			"Scrape error status for the snapshot/SLM collector",
+			nil,
+			nil,
+		),
+		scrapeDurationMetric: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "snapshot_exporter", "scrape_duration_seconds"),
+			"Duration of the snapshot/SLM scrape in seconds",
+			nil,
+			nil,
+		),
+	}, nil
+}
+
+func (c *SnapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.snapshotStateMetric
+	ch <- c.snapshotStartTimeMetric
+	ch <- c.snapshotDurationMetric
+	ch <- c.snapshotFailedShardsMetric
+	ch <- c.snapshotTotalShardsMetric
+	ch <- c.slmPolicyLastSuccessMetric
+	ch <- c.slmPolicyLastFailureMetric
+	ch <- c.slmOperationModeMetric
+	ch <- c.slmSnapshotsTakenMetric
+	ch <- c.slmSnapshotsFailedMetric
+	ch <- c.slmSnapshotsDeletedMetric
+	ch <- c.scrapeErrorMetric
+	ch <- c.scrapeDurationMetric
+}
+
+func (c *SnapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	start := time.Now()
+	scrapeError := 0.0
+
+	var cluster, clusterUUID, esVersion string
+	if c.clusterInfo != nil {
+		info := c.clusterInfo.Get()
+		cluster, clusterUUID, esVersion = info.ClusterName, info.ClusterUUID, info.ESVersion
+	}
+
+	if c.CollectSnapshots {
+		if err := c.collectSnapshots(ch, cluster, clusterUUID, esVersion); err != nil {
+			log.Printf("Error collecting snapshots: %v", err)
+			scrapeError = 1.0
+		}
+	}
+
+	if c.CollectSLM {
+		if err := c.collectSLM(ch, cluster, clusterUUID, esVersion); err != nil {
+			log.Printf("Error collecting SLM state: %v", err)
+			scrapeError = 1.0
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.scrapeErrorMetric, prometheus.GaugeValue, scrapeError)
+	ch <- prometheus.MustNewConstMetric(c.scrapeDurationMetric, prometheus.GaugeValue, time.Since(start).Seconds())
+}
+
+func (c *SnapshotCollector) collectSnapshots(ch chan<- prometheus.Metric, cluster, clusterUUID, esVersion string) error {
+	repos, err := c.fetchRepositories()
+	if err != nil {
+		return err
+	}
+
+	for repo := range repos {
+		snapshots, err := c.fetchSnapshots(repo)
+		if err != nil {
+			log.Printf("Error fetching snapshots for repo %s: %v", repo, err)
+			continue
+		}
+
+		for _, s := range snapshots {
+			ch <- prometheus.MustNewConstMetric(c.snapshotStateMetric, prometheus.GaugeValue, 1, repo, s.Snapshot, s.State, cluster, clusterUUID, esVersion)
+			ch <- prometheus.MustNewConstMetric(c.snapshotStartTimeMetric, prometheus.GaugeValue, float64(s.StartTimeInMillis)/1000, repo, s.Snapshot, cluster, clusterUUID, esVersion)
+			ch <- prometheus.MustNewConstMetric(c.snapshotDurationMetric, prometheus.GaugeValue, float64(s.DurationInMillis)/1000, repo, s.Snapshot, cluster, clusterUUID, esVersion)
+			ch <- prometheus.MustNewConstMetric(c.snapshotFailedShardsMetric, prometheus.GaugeValue, float64(s.Shards.Failed), repo, s.Snapshot, cluster, clusterUUID, esVersion)
+			ch <- prometheus.MustNewConstMetric(c.snapshotTotalShardsMetric, prometheus.GaugeValue, float64(s.Shards.Total), repo, s.Snapshot, cluster, clusterUUID, esVersion)
+		}
+	}
+
+	return nil
+}
+
+func (c *SnapshotCollector) collectSLM(ch chan<- prometheus.Metric, cluster, clusterUUID, esVersion string) error {
+	policies, err := c.fetchSLMPolicies()
+	if err != nil {
+		return err
+	}
+
+	for name, p := range policies {
+		if p.LastSuccess.Time > 0 {
+			ch <- prometheus.MustNewConstMetric(c.slmPolicyLastSuccessMetric, prometheus.GaugeValue, float64(p.LastSuccess.Time)/1000, name, cluster, clusterUUID, esVersion)
+		}
+		if p.LastFailure.Time > 0 {
+			ch <- prometheus.MustNewConstMetric(c.slmPolicyLastFailureMetric, prometheus.GaugeValue, float64(p.LastFailure.Time)/1000, name, cluster, clusterUUID, esVersion)
+		}
+	}
+
+	status, err := c.fetchSLMStatus()
+	if err != nil {
+		return err
+	}
+
+	if status.OperationMode != "" {
+		ch <- prometheus.MustNewConstMetric(c.slmOperationModeMetric, prometheus.GaugeValue, 1, status.OperationMode, cluster, clusterUUID, esVersion)
+	}
+
+	stats, err := c.fetchSLMStats()
+	if err != nil {
+		return err
+	}
+
+	for _, ps := range stats.PolicyStats {
+		ch <- prometheus.MustNewConstMetric(c.slmSnapshotsTakenMetric, prometheus.CounterValue, float64(ps.SnapshotsTaken), ps.Policy, cluster, clusterUUID, esVersion)
+		ch <- prometheus.MustNewConstMetric(c.slmSnapshotsFailedMetric, prometheus.CounterValue, float64(ps.SnapshotsFailed), ps.Policy, cluster, clusterUUID, esVersion)
+		ch <- prometheus.MustNewConstMetric(c.slmSnapshotsDeletedMetric, prometheus.CounterValue, float64(ps.SnapshotsDeleted), ps.Policy, cluster, clusterUUID, esVersion)
+	}
+
+	return nil
+}
+
+func (c *SnapshotCollector) fetchRepositories() (snapshotRepositoriesResponse, error) {
+	var repos snapshotRepositoriesResponse
+	if err := c.getJSON("/_snapshot/_all", &repos); err != nil {
+		return nil, fmt.Errorf("failed to fetch repositories: %w", err)
+	}
+	return repos, nil
+}
+
+func (c *SnapshotCollector) fetchSnapshots(repo string) ([]snapshotInfo, error) {
+	var resp repositorySnapshotsResponse
+	if err := c.getJSON(fmt.Sprintf("/_snapshot/%s/_all", repo), &resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch snapshots: %w", err)
+	}
+	return resp.Snapshots, nil
+}
+
+func (c *SnapshotCollector) fetchSLMPolicies() (map[string]slmPolicyEntry, error) {
+	var policies map[string]slmPolicyEntry
+	if err := c.getJSON("/_slm/policy", &policies); err != nil {
+		return nil, fmt.Errorf("failed to fetch SLM policies: %w", err)
+	}
+	return policies, nil
+}
+
+func (c *SnapshotCollector) fetchSLMStatus() (*slmStatusResponse, error) {
+	var status slmStatusResponse
+	if err := c.getJSON("/_slm/status", &status); err != nil {
+		return nil, fmt.Errorf("failed to fetch SLM status: %w", err)
+	}
+	return &status, nil
+}
+
+func (c *SnapshotCollector) fetchSLMStats() (*slmStatsResponse, error) {
+	var stats slmStatsResponse
+	if err := c.getJSON("/_slm/stats", &stats); err != nil {
+		return nil, fmt.Errorf("failed to fetch SLM stats: %w", err)
+	}
+	return &stats, nil
+}
+
+// getJSON issues an authenticated GET against path on the configured
+// cluster and decodes the JSON response body into out.
+func (c *SnapshotCollector) getJSON(path string, out interface{}) error {
+	req, err := http.NewRequest("GET", c.config.ESURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if c.config.ESUser != "" && c.config.ESPass != "" {
+		req.SetBasicAuth(c.config.ESUser, c.config.ESPass)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
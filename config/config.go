@@ -0,0 +1,73 @@
+// Package config loads the exporter's multi-target configuration file,
+// which maps named auth modules to the credentials used to reach a given
+// Elasticsearch cluster. It follows the same shape as the Prometheus
+// blackbox_exporter's module file: targets are supplied per-scrape via the
+// /probe endpoint, and only the auth parameters live on disk.
+package config
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// AuthModule describes how to authenticate to an Elasticsearch cluster
+// referenced by name from a /probe?auth= query parameter.
+type AuthModule struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	Region  string `yaml:"region"`
+	RoleARN string `yaml:"role_arn"`
+}
+
+// Config is the top-level structure of the --config.file YAML document.
+type Config struct {
+	AuthModules map[string]AuthModule `yaml:"auth_modules"`
+}
+
+// SafeConfig wraps Config behind an RWMutex so it can be reloaded while the
+// exporter is serving /probe requests.
+type SafeConfig struct {
+	mu sync.RWMutex
+	C  *Config
+}
+
+// LoadFile reads and parses the YAML config at path, replacing the current
+// configuration on success. An empty path is treated as "no config file" and
+// leaves an empty (but non-nil) Config in place.
+func (sc *SafeConfig) LoadFile(path string) error {
+	cfg := &Config{}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("parsing config file: %w", err)
+		}
+	}
+
+	sc.mu.Lock()
+	sc.C = cfg
+	sc.mu.Unlock()
+
+	return nil
+}
+
+// AuthModule looks up a named auth module. ok is false when name is empty
+// (no auth requested) or not present in the loaded config.
+func (sc *SafeConfig) AuthModule(name string) (mod AuthModule, ok bool) {
+	if name == "" {
+		return AuthModule{}, false
+	}
+
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	mod, ok = sc.C.AuthModules[name]
+	return mod, ok
+}
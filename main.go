@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"elasticsearch-shard-exporter/clusterinfo"
 	"elasticsearch-shard-exporter/collector"
+	appconfig "elasticsearch-shard-exporter/config"
 )
 
 var (
@@ -19,14 +25,97 @@ var (
 )
 
 type Config struct {
-	ListenAddr    string
-	MetricsPath   string
-	ESUrl         string
-	ESUser        string
-	ESPass        string
-	SSLEnable     bool
-	SSLSkipVerify bool
-	ShowVersion   bool
+	ListenAddr          string
+	MetricsPath         string
+	ConfigFile          string
+	ESUrl               string
+	ESUser              string
+	ESPass              string
+	SSLEnable           bool
+	SSLSkipVerify       bool
+	IndicesSelector     string
+	AWSRegion           string
+	AWSRoleARN          string
+	CollectNodes        bool
+	ESLocal             bool
+	CollectSnapshots    bool
+	CollectSLM          bool
+	ESTimeout           time.Duration
+	ESRetries           int
+	ESRetryBackoff      time.Duration
+	CAFile              string
+	ClientCertFile      string
+	ClientKeyFile       string
+	ClusterInfoInterval time.Duration
+	ShowVersion         bool
+}
+
+// collectorCache hands out a ShardCollector per probed target (and auth
+// module), reusing one across scrapes of the same target instead of paying
+// connection-setup cost on every /probe request.
+type collectorCache struct {
+	mu         sync.Mutex
+	collectors map[string]*collector.ShardCollector
+}
+
+func newCollectorCache() *collectorCache {
+	return &collectorCache{collectors: make(map[string]*collector.ShardCollector)}
+}
+
+func (cc *collectorCache) get(key string, cfg collector.CollectorConfig, ci *clusterinfo.Retriever) (*collector.ShardCollector, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if sc, ok := cc.collectors[key]; ok {
+		return sc, nil
+	}
+
+	sc, err := collector.NewShardCollector(cfg, ci)
+	if err != nil {
+		return nil, err
+	}
+	cc.collectors[key] = sc
+	return sc, nil
+}
+
+// clusterInfoCache hands out a clusterinfo.Retriever per target, started
+// once on first probe of that target.
+type clusterInfoCache struct {
+	mu         sync.Mutex
+	interval   time.Duration
+	retrievers map[string]*clusterinfo.Retriever
+}
+
+func newClusterInfoCache(interval time.Duration) *clusterInfoCache {
+	return &clusterInfoCache{interval: interval, retrievers: make(map[string]*clusterinfo.Retriever)}
+}
+
+// get returns the cached retriever for target, or starts a new one in the
+// background. Unlike the startup path, /probe requests don't block on the
+// first poll: an ad hoc probe of an unreachable target shouldn't hang the
+// HTTP request, so labels are simply empty until the first poll succeeds.
+func (cic *clusterInfoCache) get(target string, cfg collector.CollectorConfig) (*clusterinfo.Retriever, error) {
+	cic.mu.Lock()
+	defer cic.mu.Unlock()
+
+	if ci, ok := cic.retrievers[target]; ok {
+		return ci, nil
+	}
+
+	client, err := collector.NewHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ci := clusterinfo.New(strings.TrimSuffix(target, "/")+"/", client, cic.interval, cfg.ESUser, cfg.ESPass)
+	go func() {
+		if err := ci.Run(context.Background()); err != nil {
+			log.Printf("clusterinfo: giving up on %s: %v", target, err)
+		}
+	}()
+
+	cic.retrievers[target] = ci
+	return ci, nil
 }
 
 func main() {
@@ -37,24 +126,17 @@ func main() {
 		os.Exit(0)
 	}
 
-	if err := validateConfig(config); err != nil {
-		log.Fatalf("Configuration error: %v", err)
+	safeConfig := &appconfig.SafeConfig{}
+	if err := safeConfig.LoadFile(config.ConfigFile); err != nil {
+		log.Fatalf("Error loading config file %q: %v", config.ConfigFile, err)
 	}
 
-	shardCollector, err := collector.NewShardCollector(collector.CollectorConfig{
-		ESURL:         config.ESUrl,
-		ESUser:        config.ESUser,
-		ESPass:        config.ESPass,
-		SSLEnable:     config.SSLEnable,
-		SSLSkipVerify: config.SSLSkipVerify,
-	})
-	if err != nil {
-		log.Fatalf("Failed to create collector: %v", err)
-	}
-
-	prometheus.MustRegister(shardCollector)
+	cache := newCollectorCache()
+	ciCache := newClusterInfoCache(config.ClusterInfoInterval)
 
 	http.Handle(config.MetricsPath, promhttp.Handler())
+	http.HandleFunc("/probe", probeHandler(config, safeConfig, cache, ciCache))
+
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.Write([]byte(`<!DOCTYPE html>
@@ -63,6 +145,7 @@ func main() {
 <body>
 <h1>Elasticsearch Shard Exporter</h1>
 <p><a href="` + config.MetricsPath + `">Metrics</a></p>
+<p><a href="/probe?target=http://localhost:9200">Probe example</a></p>
 <p>Version: ` + Version + `</p>
 </body>
 </html>`))
@@ -73,26 +156,162 @@ func main() {
 		w.Write([]byte("OK"))
 	})
 
+	// A default --es-url still gets registered on --metrics-path directly so
+	// existing single-cluster deployments don't have to switch to /probe.
+	if config.ESUrl != "" {
+		baseCfg := collector.CollectorConfig{
+			ESURL:          config.ESUrl,
+			ESUser:         config.ESUser,
+			ESPass:         config.ESPass,
+			SSLEnable:      config.SSLEnable,
+			SSLSkipVerify:  config.SSLSkipVerify,
+			AWSRegion:      config.AWSRegion,
+			AWSRoleARN:     config.AWSRoleARN,
+			CAFile:         config.CAFile,
+			ClientCertFile: config.ClientCertFile,
+			ClientKeyFile:  config.ClientKeyFile,
+			Timeout:        config.ESTimeout,
+			Retries:        config.ESRetries,
+			RetryBackoff:   config.ESRetryBackoff,
+		}
+
+		shardCfg := baseCfg
+		shardCfg.IndicesSelector = config.IndicesSelector
+
+		ciClient, err := collector.NewHTTPClient(baseCfg)
+		if err != nil {
+			log.Fatalf("Failed to build clusterinfo HTTP client: %v", err)
+		}
+		ci := clusterinfo.New(strings.TrimSuffix(config.ESUrl, "/")+"/", ciClient, config.ClusterInfoInterval, config.ESUser, config.ESPass)
+		if err := ci.Run(context.Background()); err != nil {
+			log.Fatalf("Failed initial cluster info retrieval: %v", err)
+		}
+		prometheus.MustRegister(ci)
+
+		shardCollector, err := collector.NewShardCollector(shardCfg, ci)
+		if err != nil {
+			log.Fatalf("Failed to create collector: %v", err)
+		}
+		prometheus.MustRegister(shardCollector)
+
+		if config.CollectNodes {
+			nodesCollector, err := collector.NewNodesCollector(baseCfg, config.ESLocal, ci)
+			if err != nil {
+				log.Fatalf("Failed to create nodes collector: %v", err)
+			}
+			prometheus.MustRegister(nodesCollector)
+		}
+
+		if config.CollectSnapshots || config.CollectSLM {
+			snapshotCollector, err := collector.NewSnapshotCollector(baseCfg, config.CollectSnapshots, config.CollectSLM, ci)
+			if err != nil {
+				log.Fatalf("Failed to create snapshot collector: %v", err)
+			}
+			prometheus.MustRegister(snapshotCollector)
+		}
+	}
+
 	log.Printf("Starting Elasticsearch Shard Exporter v%s", Version)
-	log.Printf("Elasticsearch URL: %s", config.ESUrl)
+	if config.ESUrl != "" {
+		log.Printf("Default Elasticsearch URL: %s", config.ESUrl)
+	}
 	log.Printf("Listening on %s", config.ListenAddr)
 	log.Printf("Metrics available at http://%s%s", config.ListenAddr, config.MetricsPath)
+	log.Printf("Multi-target probes available at http://%s/probe?target=<es-url>", config.ListenAddr)
 
 	if err := http.ListenAndServe(config.ListenAddr, nil); err != nil {
 		log.Fatalf("Failed to start HTTP server: %v", err)
 	}
 }
 
+// probeHandler implements the blackbox-exporter-style /probe endpoint: it
+// builds (or reuses) a ShardCollector for the requested target, registers it
+// against a fresh registry, and serves that registry's output instead of the
+// process-wide default registry used by --metrics-path.
+func probeHandler(defaults Config, safeConfig *appconfig.SafeConfig, cache *collectorCache, ciCache *clusterInfoCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		cfg := collector.CollectorConfig{
+			ESURL:           target,
+			SSLEnable:       defaults.SSLEnable,
+			SSLSkipVerify:   defaults.SSLSkipVerify,
+			IndicesSelector: defaults.IndicesSelector,
+			AWSRegion:       defaults.AWSRegion,
+			AWSRoleARN:      defaults.AWSRoleARN,
+			CAFile:          defaults.CAFile,
+			ClientCertFile:  defaults.ClientCertFile,
+			ClientKeyFile:   defaults.ClientKeyFile,
+			Timeout:         defaults.ESTimeout,
+			Retries:         defaults.ESRetries,
+			RetryBackoff:    defaults.ESRetryBackoff,
+		}
+
+		authName := r.URL.Query().Get("auth")
+		if authName != "" {
+			mod, ok := safeConfig.AuthModule(authName)
+			if !ok {
+				http.Error(w, fmt.Sprintf("unknown auth module %q", authName), http.StatusBadRequest)
+				return
+			}
+			cfg.ESUser = mod.Username
+			cfg.ESPass = mod.Password
+			if mod.Region != "" {
+				cfg.AWSRegion = mod.Region
+			}
+			if mod.RoleARN != "" {
+				cfg.AWSRoleARN = mod.RoleARN
+			}
+		}
+
+		ci, err := ciCache.get(target, cfg)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to start cluster info retriever: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		sc, err := cache.get(target+"|"+authName, cfg, ci)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to create collector: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(&collector.RequestCollector{Inner: sc, Ctx: r.Context()})
+
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
+
 func parseFlags() Config {
 	config := Config{}
 
 	flag.StringVar(&config.ListenAddr, "listen-address", ":9061", "Address to listen on for HTTP requests")
 	flag.StringVar(&config.MetricsPath, "metrics-path", "/metrics", "Path under which to expose metrics")
-	flag.StringVar(&config.ESUrl, "es-url", "", "Elasticsearch URL (required)")
+	flag.StringVar(&config.ConfigFile, "config.file", "", "Path to YAML file defining auth_modules for multi-target /probe scraping")
+	flag.StringVar(&config.ESUrl, "es-url", "", "Default Elasticsearch URL served on --metrics-path (optional when scraping exclusively via /probe)")
 	flag.StringVar(&config.ESUser, "es-user", "", "Elasticsearch username for authentication")
 	flag.StringVar(&config.ESPass, "es-pass", "", "Elasticsearch password for authentication")
 	flag.BoolVar(&config.SSLEnable, "ssl-enable", false, "Enable SSL/TLS for Elasticsearch connection")
 	flag.BoolVar(&config.SSLSkipVerify, "ssl-skip-verify", false, "Skip SSL certificate verification")
+	flag.StringVar(&config.IndicesSelector, "es.indices-selector", "_all", "Comma-separated index patterns to scope shard/health collection to (e.g. logs-*,metrics-*)")
+	flag.StringVar(&config.AWSRegion, "aws.region", "", "AWS region for SigV4-signed requests to Amazon OpenSearch Service (enables signing when set)")
+	flag.StringVar(&config.AWSRoleARN, "aws.role-arn", "", "IAM role ARN to assume via STS before SigV4-signing requests")
+	flag.BoolVar(&config.CollectNodes, "collector.nodes", false, "Enable the /_nodes/stats collector")
+	flag.BoolVar(&config.ESLocal, "es.local", false, "When --collector.nodes is set, scrape only the locally connected node (/_nodes/_local/stats)")
+	flag.BoolVar(&config.CollectSnapshots, "collector.snapshots", false, "Enable the repository snapshot collector")
+	flag.BoolVar(&config.CollectSLM, "collector.slm", false, "Enable the Snapshot Lifecycle Management (SLM) collector")
+	flag.DurationVar(&config.ESTimeout, "es.timeout", 10*time.Second, "Per-endpoint timeout budget for each shard/health ES API call made during a scrape")
+	flag.IntVar(&config.ESRetries, "es.retries", 0, "Number of additional attempts for a failed shard/health ES API call on a 5xx response or network error")
+	flag.DurationVar(&config.ESRetryBackoff, "es.retry-backoff", 200*time.Millisecond, "Base backoff duration between retries, doubled on each attempt")
+	flag.StringVar(&config.CAFile, "es.ca", "", "Path to a PEM CA bundle to verify the Elasticsearch server certificate")
+	flag.StringVar(&config.ClientCertFile, "es.client-cert", "", "Path to a PEM client certificate for mTLS authentication to Elasticsearch")
+	flag.StringVar(&config.ClientKeyFile, "es.client-private-key", "", "Path to the PEM private key matching --es.client-cert")
+	flag.DurationVar(&config.ClusterInfoInterval, "es.clusterinfo.interval", 5*time.Minute, "How often to refresh the cluster_name/cluster_uuid/es_version labels from GET /")
 	flag.BoolVar(&config.ShowVersion, "version", false, "Show version information")
 
 	flag.Parse()
@@ -109,10 +328,3 @@ func parseFlags() Config {
 
 	return config
 }
-
-func validateConfig(config Config) error {
-	if config.ESUrl == "" {
-		return fmt.Errorf("--es-url is required (or set ES_URL environment variable)")
-	}
-	return nil
-}